@@ -0,0 +1,237 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/timewasted/go-accept-headers"
+	"github.com/tsukanov/beaten-games/data"
+)
+
+// wantsJSON decides, based on the request's Accept header, whether the
+// client should get a JSON response instead of the regular HTML page.
+// API clients that ask for application/json (or */*, the common default)
+// get JSON; browsers that explicitly prefer text/html get HTML.
+func wantsJSON(r *http.Request) bool {
+	best, err := accept.Negotiate(r.Header.Get("Accept"), "application/json", "text/html")
+	if err != nil {
+		return true
+	}
+	return best != "text/html"
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, "Internal error.", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(b)
+}
+
+// apiGame is the wire representation of data.Game used by the JSON API and
+// by export/import. It carries every field data.Game persists. Importing an
+// export reads back only the name, note, platform, rating and beaten date;
+// status, hours played and start date are not restored.
+type apiGame struct {
+	ID          int      `json:"id"`
+	Name        string   `json:"name"`
+	Note        string   `json:"note,omitempty"`
+	Platform    string   `json:"platform,omitempty"`
+	Status      string   `json:"status,omitempty"`
+	Rating      *int     `json:"rating,omitempty"`
+	HoursPlayed *float64 `json:"hours_played,omitempty"`
+	StartedOn   string   `json:"started_on,omitempty"`
+	BeatenOn    string   `json:"beaten_on,omitempty"`
+}
+
+func toAPIGame(g data.Game) apiGame {
+	a := apiGame{ID: g.ID, Name: g.Name, Platform: g.Platform, Status: g.Status}
+	if g.Note.Valid {
+		a.Note = g.Note.String
+	}
+	if g.Rating.Valid {
+		rating := int(g.Rating.Int64)
+		a.Rating = &rating
+	}
+	if g.HoursPlayed.Valid {
+		hours := g.HoursPlayed.Float64
+		a.HoursPlayed = &hours
+	}
+	if g.StartedOn.Valid {
+		a.StartedOn = g.StartedOn.Time.Format("2006-01-02")
+	}
+	if g.BeatenOn.Valid {
+		a.BeatenOn = g.BeatenOn.Time.Format("2006-01-02")
+	}
+	return a
+}
+
+func apiGamesHandler(w http.ResponseWriter, r *http.Request, userID int) {
+	switch r.Method {
+	case "GET":
+		if !wantsJSON(r) {
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+			return
+		}
+		games, err := data.GetAllGames(userID)
+		if err != nil {
+			http.Error(w, "Failed to get games.", http.StatusInternalServerError)
+			return
+		}
+		apiGames := make([]apiGame, len(games))
+		for i, g := range games {
+			apiGames[i] = toAPIGame(g)
+		}
+		writeJSON(w, http.StatusOK, apiGames)
+
+	case "POST":
+		var in apiGame
+		if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+			http.Error(w, "Failed to parse request body.", http.StatusBadRequest)
+			return
+		}
+		game, err := fromAPIGame(userID, 0, in)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		gameID, err := data.AddGame(game)
+		if err != nil {
+			http.Error(w, "Failed to add a game.", http.StatusInternalServerError)
+			return
+		}
+		enqueueEnrichment(gameID, game.Name)
+		in.ID = gameID
+		writeJSON(w, http.StatusCreated, in)
+
+	default:
+		http.Error(w, "Method not allowed.", http.StatusMethodNotAllowed)
+	}
+}
+
+func apiGameHandler(w http.ResponseWriter, r *http.Request, userID int) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Failed to parse game ID.", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		if !wantsJSON(r) {
+			http.Redirect(w, r, fmt.Sprintf("/games/%d", id), http.StatusSeeOther)
+			return
+		}
+		game, err := data.GetGame(userID, id)
+		if err != nil {
+			http.Error(w, "Game not found.", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, toAPIGame(game))
+
+	case "PUT":
+		var in apiGame
+		if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+			http.Error(w, "Failed to parse request body.", http.StatusBadRequest)
+			return
+		}
+		game, err := fromAPIGame(userID, id, in)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := data.UpdateGame(game); err != nil {
+			http.Error(w, "Failed to update the game.", http.StatusInternalServerError)
+			return
+		}
+		in.ID = id
+		writeJSON(w, http.StatusOK, in)
+
+	case "DELETE":
+		rowsAffected, err := data.DeleteGameByID(userID, id)
+		if err != nil {
+			http.Error(w, "Failed to delete the game.", http.StatusInternalServerError)
+			return
+		}
+		if rowsAffected == 0 {
+			http.Error(w, "Game not found.", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "Method not allowed.", http.StatusMethodNotAllowed)
+	}
+}
+
+func fromAPIGame(userID, id int, in apiGame) (data.Game, error) {
+	game := data.Game{ID: id, UserID: userID, Name: in.Name, Platform: in.Platform, Status: in.Status}
+	if in.Status != "" && !data.ValidStatus(in.Status) {
+		return game, fmt.Errorf("unknown status")
+	}
+	game.Note = sql.NullString{String: in.Note, Valid: in.Note != ""}
+	if in.Rating != nil {
+		if *in.Rating < 0 || *in.Rating > 10 {
+			return game, fmt.Errorf("rating must be between 0 and 10")
+		}
+		game.Rating = sql.NullInt64{Int64: int64(*in.Rating), Valid: true}
+	}
+	if in.HoursPlayed != nil {
+		game.HoursPlayed = sql.NullFloat64{Float64: *in.HoursPlayed, Valid: true}
+	}
+	if in.StartedOn != "" {
+		parsed, err := time.Parse("2006-01-02", in.StartedOn)
+		if err != nil {
+			return game, err
+		}
+		game.StartedOn = data.NullTime{Time: parsed, Valid: true}
+	}
+	if in.BeatenOn != "" {
+		parsed, err := time.Parse("2006-01-02", in.BeatenOn)
+		if err != nil {
+			return game, err
+		}
+		game.BeatenOn = data.NullTime{Time: parsed, Valid: true}
+	}
+	return game, nil
+}
+
+// apiStats is the payload returned by GET /api/v1/stats.
+type apiStats struct {
+	Total             int            `json:"total"`
+	BeatenPerYear     map[string]int `json:"beaten_per_year"`
+	BeatenPerPlatform map[string]int `json:"beaten_per_platform"`
+}
+
+func apiStatsHandler(w http.ResponseWriter, r *http.Request, userID int) {
+	games, err := data.GetAllGames(userID)
+	if err != nil {
+		http.Error(w, "Failed to get games.", http.StatusInternalServerError)
+		return
+	}
+
+	stats := apiStats{
+		Total:             len(games),
+		BeatenPerYear:     map[string]int{},
+		BeatenPerPlatform: map[string]int{},
+	}
+	for _, g := range games {
+		if !g.BeatenOn.Valid {
+			continue
+		}
+		year := strconv.Itoa(g.BeatenOn.Time.Year())
+		stats.BeatenPerYear[year]++
+		if g.Platform != "" {
+			stats.BeatenPerPlatform[g.Platform]++
+		}
+	}
+	writeJSON(w, http.StatusOK, stats)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// suggestTTL is how long a cached /suggest/games response stays fresh.
+const suggestTTL = time.Hour
+
+type suggestCacheEntry struct {
+	Body      json.RawMessage `json:"body"`
+	ExpiresOn time.Time       `json:"expires_on"`
+}
+
+// suggestCache is an in-memory cache of /suggest/games responses, keyed by
+// the raw query string, backed by a file on disk so warm entries survive a
+// restart.
+type suggestCache struct {
+	mu      sync.Mutex
+	path    string
+	entries map[string]suggestCacheEntry
+}
+
+func newSuggestCache(path string) *suggestCache {
+	c := &suggestCache{path: path, entries: map[string]suggestCacheEntry{}}
+	c.load()
+	return c
+}
+
+func (c *suggestCache) load() {
+	f, err := os.Open(c.path)
+	if err != nil {
+		return // no cache on disk yet, start empty
+	}
+	defer f.Close()
+
+	if err := json.NewDecoder(f).Decode(&c.entries); err != nil {
+		log.Println("Failed to load suggest cache:", err)
+	}
+}
+
+func (c *suggestCache) save() {
+	c.mu.Lock()
+	snapshot := make(map[string]suggestCacheEntry, len(c.entries))
+	for k, v := range c.entries {
+		snapshot[k] = v
+	}
+	c.mu.Unlock()
+
+	f, err := os.Create(c.path)
+	if err != nil {
+		log.Println("Failed to save suggest cache:", err)
+		return
+	}
+	defer f.Close()
+
+	if err := json.NewEncoder(f).Encode(snapshot); err != nil {
+		log.Println("Failed to save suggest cache:", err)
+	}
+}
+
+// Get returns the cached body for query, if present and not expired.
+func (c *suggestCache) Get(query string) (json.RawMessage, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[query]
+	if !ok || time.Now().After(entry.ExpiresOn) {
+		return nil, false
+	}
+	return entry.Body, true
+}
+
+// Set stores body for query and persists the cache to disk.
+func (c *suggestCache) Set(query string, body json.RawMessage) {
+	c.mu.Lock()
+	c.entries[query] = suggestCacheEntry{Body: body, ExpiresOn: time.Now().Add(suggestTTL)}
+	c.mu.Unlock()
+
+	c.save()
+}
@@ -0,0 +1,75 @@
+// Package data provides access to the application's persistent storage.
+package data
+
+import (
+	"database/sql"
+	"strings"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+var db *sql.DB
+
+// InitDB opens the SQLite database at path and makes sure all the tables
+// the application needs are present.
+func InitDB(path string) error {
+	var err error
+	db, err = sql.Open("sqlite3", path)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS users (
+			id            INTEGER PRIMARY KEY AUTOINCREMENT,
+			username      TEXT NOT NULL UNIQUE,
+			password_hash TEXT NOT NULL,
+			created_on    DATETIME NOT NULL
+		);
+		CREATE TABLE IF NOT EXISTS games (
+			id        INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id   INTEGER NOT NULL REFERENCES users(id),
+			name      TEXT NOT NULL,
+			note      TEXT,
+			beaten_on DATETIME
+		);
+		CREATE TABLE IF NOT EXISTS game_details (
+			game_id      INTEGER PRIMARY KEY REFERENCES games(id),
+			gb_id        INTEGER NOT NULL,
+			platforms    TEXT,
+			release_date DATETIME,
+			cover_url    TEXT,
+			description  TEXT,
+			fetched_on   DATETIME NOT NULL
+		);
+	`)
+	if err != nil {
+		return err
+	}
+
+	return addBacklogColumns()
+}
+
+// addBacklogColumns adds the columns that turned games from a simple
+// "beaten games" log into a full backlog, for databases created before
+// they existed. SQLite has no "ADD COLUMN IF NOT EXISTS", so we just ignore
+// the "duplicate column" error on an already-migrated database.
+func addBacklogColumns() error {
+	statements := []string{
+		"ALTER TABLE games ADD COLUMN platform TEXT NOT NULL DEFAULT ''",
+		"ALTER TABLE games ADD COLUMN status TEXT NOT NULL DEFAULT 'backlog'",
+		"ALTER TABLE games ADD COLUMN rating INTEGER",
+		"ALTER TABLE games ADD COLUMN hours_played REAL",
+		"ALTER TABLE games ADD COLUMN started_on DATETIME",
+	}
+	for _, stmt := range statements {
+		if _, err := db.Exec(stmt); err != nil && !isDuplicateColumn(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func isDuplicateColumn(err error) bool {
+	return strings.Contains(err.Error(), "duplicate column name")
+}
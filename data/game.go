@@ -0,0 +1,244 @@
+package data
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"time"
+)
+
+// NullTime represents a time.Time that may be NULL in the database.
+// It implements the sql.Scanner and driver.Valuer interfaces so it can be
+// used in place of a plain time.Time wherever a column is optional.
+type NullTime struct {
+	Time  time.Time
+	Valid bool
+}
+
+// Scan implements the sql.Scanner interface.
+func (nt *NullTime) Scan(value interface{}) error {
+	if value == nil {
+		nt.Time, nt.Valid = time.Time{}, false
+		return nil
+	}
+	nt.Valid = true
+	nt.Time = value.(time.Time)
+	return nil
+}
+
+// Value implements the driver.Valuer interface.
+func (nt NullTime) Value() (driver.Value, error) {
+	if !nt.Valid {
+		return nil, nil
+	}
+	return nt.Time, nil
+}
+
+// Status values a game in the collection can be in.
+const (
+	StatusBacklog   = "backlog"
+	StatusPlaying   = "playing"
+	StatusBeaten    = "beaten"
+	StatusAbandoned = "abandoned"
+	StatusWishlist  = "wishlist"
+)
+
+// Game represents a single entry in a user's collection.
+type Game struct {
+	ID          int
+	UserID      int
+	Name        string
+	Note        sql.NullString
+	Platform    string
+	Status      string
+	Rating      sql.NullInt64
+	HoursPlayed sql.NullFloat64
+	StartedOn   NullTime
+	BeatenOn    NullTime
+}
+
+var gameColumns = "id, user_id, name, note, platform, status, rating, hours_played, started_on, beaten_on"
+
+func scanGame(row interface{ Scan(...interface{}) error }) (Game, error) {
+	var g Game
+	err := row.Scan(&g.ID, &g.UserID, &g.Name, &g.Note, &g.Platform, &g.Status,
+		&g.Rating, &g.HoursPlayed, &g.StartedOn, &g.BeatenOn)
+	return g, err
+}
+
+// GameFilter narrows down and orders the games returned by ListGames. The
+// zero value matches every game, sorted newest-beaten-first.
+type GameFilter struct {
+	Status   string // one of the Status* constants, or "" for any
+	Platform string // exact platform name, or "" for any
+	Year     int    // year a game was beaten in, or 0 for any
+	Sort     string // "beaten_on" (default), "rating" or "name"
+}
+
+// GetAllGames returns every game belonging to the given user, newest beaten
+// first.
+func GetAllGames(userID int) ([]Game, error) {
+	return ListGames(userID, GameFilter{})
+}
+
+// ListGames returns the games belonging to the given user that match filter.
+func ListGames(userID int, filter GameFilter) ([]Game, error) {
+	query := "SELECT " + gameColumns + " FROM games WHERE user_id = ?"
+	args := []interface{}{userID}
+
+	if filter.Status != "" {
+		query += " AND status = ?"
+		args = append(args, filter.Status)
+	}
+	if filter.Platform != "" {
+		query += " AND platform = ?"
+		args = append(args, filter.Platform)
+	}
+	if filter.Year != 0 {
+		query += " AND strftime('%Y', beaten_on) = ?"
+		args = append(args, fmt.Sprintf("%04d", filter.Year))
+	}
+
+	switch filter.Sort {
+	case "rating":
+		query += " ORDER BY rating DESC"
+	case "name":
+		query += " ORDER BY name ASC"
+	default:
+		query += " ORDER BY beaten_on DESC"
+	}
+
+	var games []Game
+	err := timeQuery("list_games", func() error {
+		rows, err := db.Query(query, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			g, err := scanGame(rows)
+			if err != nil {
+				return err
+			}
+			games = append(games, g)
+		}
+		return rows.Err()
+	})
+	return games, err
+}
+
+// Facets lists the distinct platforms and statuses present in a user's
+// collection, for rendering filter UI on the index page.
+type Facets struct {
+	Platforms []string
+	Statuses  []string
+}
+
+// GetFacets returns the distinct platform and status values used in
+// userID's collection.
+func GetFacets(userID int) (Facets, error) {
+	var f Facets
+
+	rows, err := db.Query(
+		"SELECT DISTINCT platform FROM games WHERE user_id = ? AND platform != '' ORDER BY platform",
+		userID)
+	if err != nil {
+		return f, err
+	}
+	for rows.Next() {
+		var platform string
+		if err := rows.Scan(&platform); err != nil {
+			rows.Close()
+			return f, err
+		}
+		f.Platforms = append(f.Platforms, platform)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return f, err
+	}
+
+	rows, err = db.Query(
+		"SELECT DISTINCT status FROM games WHERE user_id = ? ORDER BY status", userID)
+	if err != nil {
+		return f, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var status string
+		if err := rows.Scan(&status); err != nil {
+			return f, err
+		}
+		f.Statuses = append(f.Statuses, status)
+	}
+	return f, rows.Err()
+}
+
+// AddGame inserts a new game for game.UserID and returns its ID. A game
+// with no Status set defaults to StatusBacklog.
+func AddGame(game Game) (int, error) {
+	if game.Status == "" {
+		game.Status = StatusBacklog
+	}
+	var id int64
+	err := timeQuery("add_game", func() error {
+		res, err := db.Exec(
+			`INSERT INTO games (user_id, name, note, platform, status, rating, hours_played,
+				started_on, beaten_on) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			game.UserID, game.Name, game.Note, game.Platform, game.Status, game.Rating,
+			game.HoursPlayed, game.StartedOn, game.BeatenOn)
+		if err != nil {
+			return err
+		}
+		id, err = res.LastInsertId()
+		return err
+	})
+	return int(id), err
+}
+
+// DeleteGame removes the game with the given name that belongs to userID.
+// It returns the number of rows affected.
+func DeleteGame(userID int, name string) (int64, error) {
+	res, err := db.Exec("DELETE FROM games WHERE user_id = ? AND name = ?", userID, name)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// GetGame returns the game with the given ID that belongs to userID.
+func GetGame(userID, id int) (Game, error) {
+	row := db.QueryRow("SELECT "+gameColumns+" FROM games WHERE user_id = ? AND id = ?", userID, id)
+	return scanGame(row)
+}
+
+// UpdateGame overwrites the stored fields of the game with game.ID, scoped
+// to game.UserID.
+func UpdateGame(game Game) error {
+	_, err := db.Exec(
+		`UPDATE games SET name = ?, note = ?, platform = ?, status = ?, rating = ?,
+			hours_played = ?, started_on = ?, beaten_on = ? WHERE id = ? AND user_id = ?`,
+		game.Name, game.Note, game.Platform, game.Status, game.Rating, game.HoursPlayed,
+		game.StartedOn, game.BeatenOn, game.ID, game.UserID)
+	return err
+}
+
+// DeleteGameByID removes the game with the given ID that belongs to userID.
+// It returns the number of rows affected.
+func DeleteGameByID(userID, id int) (int64, error) {
+	res, err := db.Exec("DELETE FROM games WHERE user_id = ? AND id = ?", userID, id)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// ValidStatus reports whether s is one of the known Status* values.
+func ValidStatus(s string) bool {
+	switch s {
+	case StatusBacklog, StatusPlaying, StatusBeaten, StatusAbandoned, StatusWishlist:
+		return true
+	}
+	return false
+}
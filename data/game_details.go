@@ -0,0 +1,39 @@
+package data
+
+import (
+	"database/sql"
+	"time"
+)
+
+// GameDetail holds the Giant Bomb metadata that was resolved for a game.
+type GameDetail struct {
+	GameID      int
+	GBID        int
+	Platforms   string
+	ReleaseDate NullTime
+	CoverURL    sql.NullString
+	Description sql.NullString
+	FetchedOn   time.Time
+}
+
+// SaveGameDetails inserts or replaces the enriched metadata for a game.
+func SaveGameDetails(gd GameDetail) error {
+	_, err := db.Exec(`
+		INSERT OR REPLACE INTO game_details
+			(game_id, gb_id, platforms, release_date, cover_url, description, fetched_on)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		gd.GameID, gd.GBID, gd.Platforms, gd.ReleaseDate, gd.CoverURL, gd.Description, time.Now())
+	return err
+}
+
+// GetGameDetails returns the enriched metadata for gameID, if any has been
+// fetched yet.
+func GetGameDetails(gameID int) (GameDetail, error) {
+	var gd GameDetail
+	err := db.QueryRow(`
+		SELECT game_id, gb_id, platforms, release_date, cover_url, description, fetched_on
+		FROM game_details WHERE game_id = ?`, gameID).
+		Scan(&gd.GameID, &gd.GBID, &gd.Platforms, &gd.ReleaseDate, &gd.CoverURL,
+			&gd.Description, &gd.FetchedOn)
+	return gd, err
+}
@@ -0,0 +1,15 @@
+package data
+
+import (
+	"github.com/rcrowley/go-metrics"
+)
+
+// timeQuery records how long a named query took in the global go-metrics
+// registry, under "data.query.<name>", so the server's /metrics endpoint
+// can report DB timings alongside its HTTP ones.
+func timeQuery(name string, fn func() error) error {
+	t := metrics.GetOrRegisterTimer("data.query."+name, metrics.DefaultRegistry)
+	var err error
+	t.Time(func() { err = fn() })
+	return err
+}
@@ -0,0 +1,69 @@
+package data
+
+import (
+	"errors"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrInvalidCredentials is returned by Authenticate when the username is
+// unknown or the password doesn't match.
+var ErrInvalidCredentials = errors.New("invalid username or password")
+
+// User represents a registered account.
+type User struct {
+	ID        int
+	Username  string
+	CreatedOn time.Time
+}
+
+// CreateUser registers a new account with the given username and password,
+// storing a bcrypt hash of the password rather than the password itself.
+func CreateUser(username, password string) (User, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return User{}, err
+	}
+
+	now := time.Now()
+	res, err := db.Exec(
+		"INSERT INTO users (username, password_hash, created_on) VALUES (?, ?, ?)",
+		username, string(hash), now)
+	if err != nil {
+		return User{}, err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return User{}, err
+	}
+	return User{ID: int(id), Username: username, CreatedOn: now}, nil
+}
+
+// Authenticate looks up the user with the given username and checks the
+// password against its stored bcrypt hash.
+func Authenticate(username, password string) (User, error) {
+	var u User
+	var hash string
+	err := db.QueryRow(
+		"SELECT id, username, password_hash, created_on FROM users WHERE username = ?",
+		username).Scan(&u.ID, &u.Username, &hash, &u.CreatedOn)
+	if err != nil {
+		return User{}, ErrInvalidCredentials
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) != nil {
+		return User{}, ErrInvalidCredentials
+	}
+	return u, nil
+}
+
+// GetUserByID looks up a user by their ID.
+func GetUserByID(id int) (User, error) {
+	var u User
+	err := db.QueryRow(
+		"SELECT id, username, created_on FROM users WHERE id = ?", id).
+		Scan(&u.ID, &u.Username, &u.CreatedOn)
+	return u, err
+}
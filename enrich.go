@@ -0,0 +1,133 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tsukanov/beaten-games/data"
+	"github.com/tsukanov/go-giantbomb"
+)
+
+// giantbombMu serializes access to the go-giantbomb package's shared
+// FieldList variable, which every caller (enrichment workers and
+// suggestGamesHandler) has to write right before it calls Search.
+var giantbombMu sync.Mutex
+
+// enrichJob asks a worker to resolve Giant Bomb metadata for a game that was
+// just added under the given search query (usually the game's name).
+type enrichJob struct {
+	gameID int
+	query  string
+}
+
+// enrichQueue buffers enrichment jobs between handlers and the worker pool.
+var enrichQueue = make(chan enrichJob, 100)
+
+// startEnrichWorkers launches n workers that drain enrichQueue for as long
+// as the process runs.
+func startEnrichWorkers(n int) {
+	for i := 0; i < n; i++ {
+		go enrichWorker()
+	}
+}
+
+// enqueueEnrichment schedules background Giant Bomb lookup for a freshly
+// added game. It never blocks the request that adds the game: if the queue
+// is full the job is simply dropped and the game is left unenriched.
+func enqueueEnrichment(gameID int, query string) {
+	select {
+	case enrichQueue <- enrichJob{gameID: gameID, query: query}:
+	default:
+		log.Println("Enrichment queue is full, dropping job for game", gameID)
+	}
+}
+
+func enrichWorker() {
+	for job := range enrichQueue {
+		if err := enrichGame(job); err != nil {
+			log.Println("Failed to enrich game", job.gameID, ":", err)
+		}
+	}
+}
+
+// enrichGame resolves the Giant Bomb entry matching job.query and stores
+// its details for job.gameID, retrying with exponential backoff if Giant
+// Bomb responds with a rate-limit or server error.
+func enrichGame(job enrichJob) error {
+	backoff := time.Second
+	var result *giantbomb.Result
+	var lastErr error
+	for attempt := 0; attempt < 5; attempt++ {
+		giantbombMu.Lock()
+		giantbomb.FieldList = []string{"id", "name", "platforms", "original_release_date",
+			"image", "deck"}
+		giantBombCalls.Inc(1)
+		resp, err := giantbomb.Search(job.query, 1, 1, []string{giantbomb.ResourceTypeGame})
+		giantbombMu.Unlock()
+		if err == nil {
+			lastErr = nil
+			if len(resp.Results) > 0 {
+				result = &resp.Results[0]
+			}
+			break
+		}
+		if !isRetryable(err) {
+			return err
+		}
+		lastErr = err
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+	if lastErr != nil {
+		return lastErr // still rate-limited or failing after every retry
+	}
+	if result == nil {
+		return nil // nothing matched on Giant Bomb; leave the game unenriched
+	}
+
+	var platforms []string
+	for _, p := range result.Platforms {
+		platforms = append(platforms, p.Name)
+	}
+
+	gd := data.GameDetail{
+		GameID:    job.gameID,
+		GBID:      result.ID,
+		Platforms: strings.Join(platforms, ", "),
+		CoverURL:  sql.NullString{String: result.Image.URL, Valid: result.Image.URL != ""},
+		Description: sql.NullString{
+			String: result.Deck,
+			Valid:  result.Deck != "",
+		},
+	}
+	if result.OriginalReleaseDate != "" {
+		parsed, err := time.Parse("2006-01-02", result.OriginalReleaseDate)
+		if err == nil {
+			gd.ReleaseDate = data.NullTime{Time: parsed, Valid: true}
+		}
+	}
+
+	return data.SaveGameDetails(gd)
+}
+
+// retryableStatusCodes are the Giant Bomb HTTP statuses worth retrying:
+// 429 (rate limited) and the 5xx server errors.
+var retryableStatusCodes = []string{"429", "500", "502", "503", "504"}
+
+// isRetryable reports whether err looks like a transient Giant Bomb error
+// (rate limiting or a server-side failure) worth retrying.
+func isRetryable(err error) bool {
+	msg := err.Error()
+	if strings.Contains(msg, "rate limit") {
+		return true
+	}
+	for _, code := range retryableStatusCodes {
+		if strings.Contains(msg, code) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tsukanov/beaten-games/data"
+)
+
+// importSummary reports what an import did with each row it was given.
+type importSummary struct {
+	Created int `json:"created"`
+	Updated int `json:"updated"`
+	Skipped int `json:"skipped"`
+}
+
+func exportHandler(w http.ResponseWriter, r *http.Request, userID int) {
+	games, err := data.GetAllGames(userID)
+	if err != nil {
+		http.Error(w, "Failed to get games.", http.StatusInternalServerError)
+		return
+	}
+
+	apiGames := make([]apiGame, len(games))
+	for i, g := range games {
+		apiGames[i] = toAPIGame(g)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", `attachment; filename="beaten-games-export.json"`)
+	if err := json.NewEncoder(w).Encode(apiGames); err != nil {
+		log.Println(err)
+	}
+}
+
+func importHandler(w http.ResponseWriter, r *http.Request, userID int) {
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, "Failed to read uploaded file.", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	body, err := io.ReadAll(file)
+	if err != nil {
+		http.Error(w, "Failed to read uploaded file.", http.StatusInternalServerError)
+		return
+	}
+
+	rows, err := parseImportRows(body)
+	if err != nil {
+		http.Error(w, "Failed to parse uploaded file: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	existing, err := data.GetAllGames(userID)
+	if err != nil {
+		http.Error(w, "Failed to get games.", http.StatusInternalServerError)
+		return
+	}
+	byKey := map[string]data.Game{}
+	for _, g := range existing {
+		byKey[importDedupeKey(g.Name, g.Platform)] = g
+	}
+
+	var summary importSummary
+	for _, row := range rows {
+		if normalizeGameName(row.Name) == "" {
+			summary.Skipped++
+			continue
+		}
+		key := importDedupeKey(row.Name, row.Platform)
+
+		if current, ok := byKey[key]; ok {
+			if !row.hasUpdate(current) {
+				summary.Skipped++
+				continue
+			}
+			if row.Note != "" {
+				current.Note = row.note()
+			}
+			if beaten := row.beatenOn(); beaten.Valid {
+				current.BeatenOn = beaten
+			}
+			if row.Rating != nil {
+				current.Rating = sql.NullInt64{Int64: int64(*row.Rating), Valid: true}
+			}
+			if err := data.UpdateGame(current); err != nil {
+				log.Println(err)
+				summary.Skipped++
+				continue
+			}
+			summary.Updated++
+			continue
+		}
+
+		game := data.Game{
+			UserID:   userID,
+			Name:     row.Name,
+			Platform: row.Platform,
+			Note:     row.note(),
+			BeatenOn: row.beatenOn(),
+		}
+		if row.Rating != nil {
+			game.Rating = sql.NullInt64{Int64: int64(*row.Rating), Valid: true}
+		}
+		gameID, err := data.AddGame(game)
+		if err != nil {
+			log.Println(err)
+			summary.Skipped++
+			continue
+		}
+		enqueueEnrichment(gameID, game.Name)
+		summary.Created++
+	}
+
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusOK, summary)
+		return
+	}
+	err = executeTemplates(w, summary, "templates/import_result.html")
+	if err != nil {
+		http.Error(w, "Failed to execute template.", http.StatusInternalServerError)
+		return
+	}
+}
+
+// normalizeGameName lowercases and collapses whitespace so that minor
+// formatting differences between collection exports don't create
+// duplicate entries.
+func normalizeGameName(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
+
+// importDedupeKey identifies a game for dedupe purposes. It includes the
+// platform so that, e.g., a PS5 copy and a Switch copy of the same game
+// import as two separate entries instead of colliding.
+func importDedupeKey(name, platform string) string {
+	return normalizeGameName(name) + "|" + strings.ToLower(strings.TrimSpace(platform))
+}
+
+// importRow is a format-agnostic view of one row being imported, after the
+// JSON or CSV source has been mapped onto it.
+type importRow struct {
+	Name        string
+	Note        string
+	Platform    string
+	Rating      *int
+	CompletedOn string // "2006-01-02", empty if not completed/unknown
+}
+
+func (row importRow) note() sql.NullString {
+	return sql.NullString{String: row.Note, Valid: row.Note != ""}
+}
+
+func (row importRow) beatenOn() data.NullTime {
+	if row.CompletedOn == "" {
+		return data.NullTime{Valid: false}
+	}
+	parsed, err := time.Parse("2006-01-02", row.CompletedOn)
+	if err != nil {
+		return data.NullTime{Valid: false}
+	}
+	return data.NullTime{Time: parsed, Valid: true}
+}
+
+// hasUpdate reports whether row carries information that differs from the
+// game already on file, i.e. whether applying it would actually change
+// anything.
+func (row importRow) hasUpdate(current data.Game) bool {
+	if row.Note != "" && (!current.Note.Valid || current.Note.String != row.Note) {
+		return true
+	}
+	if beaten := row.beatenOn(); beaten.Valid && (!current.BeatenOn.Valid || !current.BeatenOn.Time.Equal(beaten.Time)) {
+		return true
+	}
+	if row.Rating != nil && (!current.Rating.Valid || current.Rating.Int64 != int64(*row.Rating)) {
+		return true
+	}
+	return false
+}
+
+// parseImportRows accepts either the JSON export format produced by
+// exportHandler or a CSV export from Steam, GOG Galaxy or an IGDB list, and
+// maps it onto a common set of rows.
+func parseImportRows(body []byte) ([]importRow, error) {
+	var asJSON []apiGame
+	if err := json.Unmarshal(body, &asJSON); err == nil {
+		rows := make([]importRow, len(asJSON))
+		for i, g := range asJSON {
+			rows[i] = importRow{
+				Name:        g.Name,
+				Note:        g.Note,
+				Platform:    g.Platform,
+				Rating:      g.Rating,
+				CompletedOn: g.BeatenOn,
+			}
+		}
+		return rows, nil
+	}
+
+	return parseImportCSV(body)
+}
+
+// csvColumnAliases maps the header names used by common collection exports
+// onto our canonical row fields.
+var csvColumnAliases = map[string][]string{
+	"name":         {"name", "title", "game", "game name"},
+	"note":         {"note", "notes", "comment", "comments"},
+	"platform":     {"platform", "platforms", "system"},
+	"rating":       {"rating", "score", "my rating", "personal rating"},
+	"completed_on": {"completion date", "date completed", "completed on", "beaten_on", "beaten on"},
+}
+
+func parseImportCSV(body []byte) ([]importRow, error) {
+	cr := csv.NewReader(strings.NewReader(string(body)))
+	cr.FieldsPerRecord = -1
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, err
+	}
+	columns := map[string]int{} // canonical field -> column index
+	for i, h := range header {
+		h = strings.ToLower(strings.TrimSpace(h))
+		for field, aliases := range csvColumnAliases {
+			for _, alias := range aliases {
+				if h == alias {
+					columns[field] = i
+				}
+			}
+		}
+	}
+	if _, ok := columns["name"]; !ok {
+		return nil, fmt.Errorf("couldn't find a name/title column")
+	}
+
+	var rows []importRow
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		row := importRow{Name: field(record, columns, "name")}
+		row.Note = field(record, columns, "note")
+		row.Platform = field(record, columns, "platform")
+		row.CompletedOn = field(record, columns, "completed_on")
+		if rating := field(record, columns, "rating"); rating != "" {
+			if parsed, err := strconv.Atoi(rating); err == nil {
+				row.Rating = &parsed
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+func field(record []string, columns map[string]int, name string) string {
+	i, ok := columns[name]
+	if !ok || i >= len(record) {
+		return ""
+	}
+	return strings.TrimSpace(record[i])
+}
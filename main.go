@@ -13,10 +13,21 @@ import (
 
 	"code.google.com/p/goconf/conf"
 	"github.com/gorilla/mux"
+	"github.com/gorilla/sessions"
 	"github.com/tsukanov/beaten-games/data"
 	"github.com/tsukanov/go-giantbomb"
 )
 
+// sessionName is the name of the cookie that stores the logged-in user's
+// session.
+const sessionName = "beaten-games-session"
+
+var store *sessions.CookieStore
+
+// suggestGamesCache caches /suggest/games responses so repeated keystrokes
+// don't all hit Giant Bomb.
+var suggestGamesCache *suggestCache
+
 func main() {
 	fmt.Println("Loading configuration...")
 	config, err := conf.ReadConfigFile("config.txt")
@@ -27,9 +38,22 @@ func main() {
 	if err != nil {
 		log.Fatal("Failed to get Giant Bomb API key from config file!", err)
 	}
+	sessionSecret, err := config.GetString("default", "session_secret")
+	if err != nil {
+		log.Fatal("Failed to get session secret from config file!", err)
+	}
+	store = sessions.NewCookieStore([]byte(sessionSecret))
+
+	err = data.InitDB("beaten-games.db")
+	if err != nil {
+		log.Fatal("Failed to open database! ", err)
+	}
+
+	suggestGamesCache = newSuggestCache("suggest-cache.json")
+	startEnrichWorkers(4)
 
 	fmt.Println("Starting server on localhost:8080...")
-	err = http.ListenAndServe(":8080", makeRouter())
+	err = http.ListenAndServe(":8080", instrumentRouter(makeRouter()))
 	if err != nil {
 		log.Fatal("ListenAndServe: ", err)
 	}
@@ -38,15 +62,31 @@ func main() {
 func makeRouter() *mux.Router {
 	r := mux.NewRouter().StrictSlash(true)
 
+	// Account management
+	r.HandleFunc("/api/account/register", registerHandler).Methods("GET", "POST")
+	r.HandleFunc("/api/account/login", loginHandler).Methods("GET", "POST")
+	r.HandleFunc("/api/account/logout", logoutHandler).Methods("POST")
+	r.HandleFunc("/api/account/info", requireAuth(accountInfoHandler))
+
 	// Regular pages
-	r.HandleFunc("/", indexHandler)
-	r.HandleFunc("/games/{id:[0-9]+}", gameHandler)
-	r.HandleFunc("/games/add", addHandler).Methods("GET", "POST")
-	r.HandleFunc("/games/quick-add", quickAddHandler).Methods("POST")
-	r.HandleFunc("/games/delete", deleteHandler).Methods("POST")
+	r.HandleFunc("/", requirePageAuth(indexHandler))
+	r.HandleFunc("/games/{id:[0-9]+}", requirePageAuth(gameHandler))
+	r.HandleFunc("/games/add", requirePageAuth(addHandler)).Methods("GET", "POST")
+	r.HandleFunc("/games/quick-add", requirePageAuth(quickAddHandler)).Methods("POST")
+	r.HandleFunc("/games/delete", requirePageAuth(deleteHandler)).Methods("POST")
+	r.HandleFunc("/games/export", requirePageAuth(exportHandler)).Methods("GET")
+	r.HandleFunc("/games/import", requirePageAuth(importHandler)).Methods("POST")
 
 	r.HandleFunc("/suggest/games", suggestGamesHandler)
 
+	// JSON API
+	r.HandleFunc("/api/v1/games", requireAuth(apiGamesHandler)).Methods("GET", "POST")
+	r.HandleFunc("/api/v1/games/{id:[0-9]+}", requireAuth(apiGameHandler)).Methods("GET", "PUT", "DELETE")
+	r.HandleFunc("/api/v1/stats", requireAuth(apiStatsHandler)).Methods("GET")
+
+	// Operational endpoints
+	r.HandleFunc("/metrics", metricsHandler)
+
 	// Static files
 	r.PathPrefix("/static/").Handler(http.StripPrefix("/static/",
 		http.FileServer(http.Dir("static"))))
@@ -66,22 +106,203 @@ func executeTemplates(wr io.Writer, data interface{}, filenames ...string) error
 	return t.ExecuteTemplate(wr, "base", data)
 }
 
-func indexHandler(w http.ResponseWriter, r *http.Request) {
-	games, err := data.GetAllGames()
+// parseOptionalDate parses an optional "2006-01-02" form value, returning a
+// NullTime that is valid only if s is non-empty and well-formed.
+func parseOptionalDate(s string) data.NullTime {
+	if s == "" {
+		return data.NullTime{Valid: false}
+	}
+	parsed, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		return data.NullTime{Valid: false}
+	}
+	return data.NullTime{Time: parsed, Valid: true}
+}
+
+// requireAuth wraps a handler that needs a logged-in user, loading the user
+// ID from the session and rejecting the request with 401 if there isn't one.
+func requireAuth(fn func(w http.ResponseWriter, r *http.Request, userID int)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, err := store.Get(r, sessionName)
+		if err != nil {
+			http.Error(w, "Failed to read session.", http.StatusInternalServerError)
+			return
+		}
+		userID, ok := session.Values["user_id"].(int)
+		if !ok {
+			http.Error(w, "Not logged in.", http.StatusUnauthorized)
+			return
+		}
+		fn(w, r, userID)
+	}
+}
+
+// requirePageAuth is like requireAuth but for handlers that serve a browser
+// page rather than JSON: a logged-out browser request is redirected to the
+// login page instead of getting a bare 401, since that's the only way for a
+// logged-out user to reach it. Requests that ask for JSON still get 401, same
+// as requireAuth.
+func requirePageAuth(fn func(w http.ResponseWriter, r *http.Request, userID int)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, err := store.Get(r, sessionName)
+		if err != nil {
+			http.Error(w, "Failed to read session.", http.StatusInternalServerError)
+			return
+		}
+		userID, ok := session.Values["user_id"].(int)
+		if !ok {
+			if wantsJSON(r) {
+				http.Error(w, "Not logged in.", http.StatusUnauthorized)
+				return
+			}
+			http.Redirect(w, r, "/api/account/login", http.StatusSeeOther)
+			return
+		}
+		fn(w, r, userID)
+	}
+}
+
+func registerHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "GET" {
+		err := executeTemplates(w, nil, "templates/register.html")
+		if err != nil {
+			http.Error(w, "Failed to execute template.", http.StatusInternalServerError)
+			return
+		}
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, "Failed to parse submitted form.", http.StatusInternalServerError)
+		return
+	}
+
+	user, err := data.CreateUser(r.Form.Get("username"), r.Form.Get("password"))
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Failed to register user.", http.StatusInternalServerError)
+		return
+	}
+
+	session, err := store.Get(r, sessionName)
+	if err != nil {
+		http.Error(w, "Failed to read session.", http.StatusInternalServerError)
+		return
+	}
+	session.Values["user_id"] = user.ID
+	if err := session.Save(r, w); err != nil {
+		http.Error(w, "Failed to save session.", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+func loginHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "GET" {
+		err := executeTemplates(w, nil, "templates/login.html")
+		if err != nil {
+			http.Error(w, "Failed to execute template.", http.StatusInternalServerError)
+			return
+		}
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, "Failed to parse submitted form.", http.StatusInternalServerError)
+		return
+	}
+
+	user, err := data.Authenticate(r.Form.Get("username"), r.Form.Get("password"))
+	if err != nil {
+		http.Error(w, "Invalid username or password.", http.StatusUnauthorized)
+		return
+	}
+
+	session, err := store.Get(r, sessionName)
+	if err != nil {
+		http.Error(w, "Failed to read session.", http.StatusInternalServerError)
+		return
+	}
+	session.Values["user_id"] = user.ID
+	if err := session.Save(r, w); err != nil {
+		http.Error(w, "Failed to save session.", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+func logoutHandler(w http.ResponseWriter, r *http.Request) {
+	session, err := store.Get(r, sessionName)
+	if err != nil {
+		http.Error(w, "Failed to read session.", http.StatusInternalServerError)
+		return
+	}
+	delete(session.Values, "user_id")
+	if err := session.Save(r, w); err != nil {
+		http.Error(w, "Failed to save session.", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func accountInfoHandler(w http.ResponseWriter, r *http.Request, userID int) {
+	user, err := data.GetUserByID(userID)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Failed to get account info.", http.StatusInternalServerError)
+		return
+	}
+
+	b, err := json.Marshal(user)
+	if err != nil {
+		http.Error(w, "Internal error.", http.StatusInternalServerError)
+		log.Println(err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
+
+func indexHandler(w http.ResponseWriter, r *http.Request, userID int) {
+	filter := data.GameFilter{
+		Status:   r.URL.Query().Get("status"),
+		Platform: r.URL.Query().Get("platform"),
+		Sort:     r.URL.Query().Get("sort"),
+	}
+	if year := r.URL.Query().Get("year"); year != "" {
+		filter.Year, _ = strconv.Atoi(year)
+	}
+
+	games, err := data.ListGames(userID, filter)
 	if err != nil {
 		log.Println(err)
 		http.Error(w, "Failed to get games.", http.StatusInternalServerError)
 		return
 	}
-	err = executeTemplates(w, struct{ Games []data.Game }{games},
-		"templates/index.html")
+	facets, err := data.GetFacets(userID)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Failed to get facets.", http.StatusInternalServerError)
+		return
+	}
+
+	err = executeTemplates(w, struct {
+		Games  []data.Game
+		Facets data.Facets
+		Filter data.GameFilter
+	}{games, facets, filter}, "templates/index.html")
 	if err != nil {
 		http.Error(w, fmt.Sprint(err), http.StatusInternalServerError)
 		return
 	}
 }
 
-func gameHandler(w http.ResponseWriter, r *http.Request) {
+func gameHandler(w http.ResponseWriter, r *http.Request, userID int) {
 	vars := mux.Vars(r)
 	id, err := strconv.Atoi(vars["id"])
 	if err != nil {
@@ -89,16 +310,29 @@ func gameHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// TODO: Implement game lookup
+	game, err := data.GetGame(userID, id)
+	if err != nil {
+		http.Error(w, "Game not found.", http.StatusNotFound)
+		return
+	}
+
+	// Details are filled in by the background enrichment worker some time
+	// after the game is added, so they may not be there yet.
+	details, err := data.GetGameDetails(id)
+	hasDetails := err == nil
 
-	err = executeTemplates(w, struct{ ID int }{id}, "templates/game.html")
+	err = executeTemplates(w, struct {
+		Game       data.Game
+		Details    data.GameDetail
+		HasDetails bool
+	}{game, details, hasDetails}, "templates/game.html")
 	if err != nil {
 		http.Error(w, "Failed to execute template.", http.StatusInternalServerError)
 		return
 	}
 }
 
-func addHandler(w http.ResponseWriter, r *http.Request) {
+func addHandler(w http.ResponseWriter, r *http.Request, userID int) {
 	if r.Method == "GET" {
 		err := executeTemplates(w, nil, "templates/add.html")
 		if err != nil {
@@ -114,13 +348,37 @@ func addHandler(w http.ResponseWriter, r *http.Request) {
 		}
 		vals := r.Form
 		var game data.Game
+		game.UserID = userID
 		game.Name = vals.Get("name")
 		game.Note = sql.NullString{
 			String: vals.Get("note"),
 			Valid:  true,
 		}
-		if len(r.Form["beaten_on"][0]) > 0 {
-			parsed, err := time.Parse("2006-01-02", r.Form["beaten_on"][0])
+		game.Platform = vals.Get("platform")
+		game.Status = vals.Get("status")
+		if game.Status != "" && !data.ValidStatus(game.Status) {
+			http.Error(w, "Unknown status.", http.StatusBadRequest)
+			return
+		}
+		if rating := vals.Get("rating"); rating != "" {
+			parsed, err := strconv.Atoi(rating)
+			if err != nil || parsed < 0 || parsed > 10 {
+				http.Error(w, "Rating must be a number between 0 and 10.", http.StatusBadRequest)
+				return
+			}
+			game.Rating = sql.NullInt64{Int64: int64(parsed), Valid: true}
+		}
+		if hours := vals.Get("hours_played"); hours != "" {
+			parsed, err := strconv.ParseFloat(hours, 64)
+			if err != nil {
+				http.Error(w, "Hours played must be a number.", http.StatusBadRequest)
+				return
+			}
+			game.HoursPlayed = sql.NullFloat64{Float64: parsed, Valid: true}
+		}
+		game.StartedOn = parseOptionalDate(vals.Get("started_on"))
+		if beatenOn := vals.Get("beaten_on"); len(beatenOn) > 0 {
+			parsed, err := time.Parse("2006-01-02", beatenOn)
 			if err != nil {
 				http.Error(w, "Failed to parse date.", http.StatusBadRequest)
 				return
@@ -135,17 +393,18 @@ func addHandler(w http.ResponseWriter, r *http.Request) {
 			}
 		}
 
-		err = data.AddGame(game)
+		gameID, err := data.AddGame(game)
 		if err != nil {
 			http.Error(w, "Failed to add a game.", http.StatusInternalServerError)
 			return
 		}
+		enqueueEnrichment(gameID, game.Name)
 
 		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
 	}
 }
 
-func quickAddHandler(w http.ResponseWriter, r *http.Request) {
+func quickAddHandler(w http.ResponseWriter, r *http.Request, userID int) {
 	err := r.ParseForm()
 	if err != nil {
 		http.Error(w, "Failed to parse submitted form.", http.StatusInternalServerError)
@@ -153,25 +412,28 @@ func quickAddHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	vals := r.Form
 	var game data.Game
+	game.UserID = userID
 	game.Name = vals.Get("name")
 	game.Note = sql.NullString{
 		Valid: false,
 	}
+	game.Status = data.StatusBeaten
 	game.BeatenOn = data.NullTime{
 		Time:  time.Now(),
 		Valid: true,
 	}
 
-	err = data.AddGame(game)
+	gameID, err := data.AddGame(game)
 	if err != nil {
 		log.Println(err)
 		http.Error(w, "Failed to add a game.", http.StatusInternalServerError)
 		return
 	}
+	enqueueEnrichment(gameID, game.Name)
 	w.WriteHeader(http.StatusOK)
 }
 
-func deleteHandler(w http.ResponseWriter, r *http.Request) {
+func deleteHandler(w http.ResponseWriter, r *http.Request, userID int) {
 	err := r.ParseForm()
 	if err != nil {
 		http.Error(w, "Failed to parse submitted form.", http.StatusInternalServerError)
@@ -179,7 +441,7 @@ func deleteHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	vals := r.Form
 	name := vals.Get("name")
-	rowsAffected, err := data.DeleteGame(vals.Get("name"))
+	rowsAffected, err := data.DeleteGame(userID, vals.Get("name"))
 	if err != nil {
 		log.Println(err)
 		http.Error(w, "Failed to delete a game.", http.StatusInternalServerError)
@@ -200,8 +462,19 @@ func suggestGamesHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if cached, ok := suggestGamesCache.Get(query[0]); ok {
+		suggestCacheHits.Inc(1)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(cached)
+		return
+	}
+	suggestCacheMisses.Inc(1)
+
+	giantbombMu.Lock()
 	giantbomb.FieldList = []string{"id", "name", "platforms"}
+	giantBombCalls.Inc(1)
 	resp, err := giantbomb.Search(query[0], 10, 1, []string{giantbomb.ResourceTypeGame})
+	giantbombMu.Unlock()
 	if err != nil {
 		http.Error(w, "Search failed.", http.StatusInternalServerError)
 		log.Println(err)
@@ -214,6 +487,7 @@ func suggestGamesHandler(w http.ResponseWriter, r *http.Request) {
 		log.Println(err)
 		return
 	}
+	suggestGamesCache.Set(query[0], b)
 
 	w.Header().Set("Content-Type", "application/json")
 	w.Write(b)
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/rcrowley/go-metrics"
+)
+
+// metricsRegistry holds every counter and timer the server exposes at
+// /metrics. It's the global go-metrics registry so that the data package
+// can register its own query timers without this package having to know
+// about them.
+var metricsRegistry = metrics.DefaultRegistry
+
+// giantBombCalls counts outgoing requests to the Giant Bomb API, across
+// both suggestGamesHandler and the background enrichment workers.
+var giantBombCalls = metrics.GetOrRegisterCounter("giantbomb.calls", metricsRegistry)
+
+// suggestCacheHits and suggestCacheMisses track the hit ratio of the
+// /suggest/games cache.
+var suggestCacheHits = metrics.GetOrRegisterCounter("suggest_cache.hits", metricsRegistry)
+var suggestCacheMisses = metrics.GetOrRegisterCounter("suggest_cache.misses", metricsRegistry)
+
+// instrumentRouter wraps every route on r with request counting, latency
+// timing and error counting, each recorded per route under its mux path
+// template (e.g. "/games/{id:[0-9]+}").
+func instrumentRouter(r *mux.Router) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		route := "unknown"
+		if match := (mux.RouteMatch{}); r.Match(req, &match) && match.Route != nil {
+			if tmpl, err := match.Route.GetPathTemplate(); err == nil {
+				route = tmpl
+			}
+		}
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		start := time.Now()
+		r.ServeHTTP(rec, req)
+		duration := time.Since(start)
+
+		metrics.GetOrRegisterCounter(route+".requests", metricsRegistry).Inc(1)
+		metrics.GetOrRegisterTimer(route+".latency", metricsRegistry).Update(duration)
+		if rec.status >= 400 {
+			metrics.GetOrRegisterCounter(route+".errors", metricsRegistry).Inc(1)
+		}
+
+		logAccess(req, rec.status, duration)
+	})
+}
+
+// statusRecorder captures the status code a handler wrote so it can be
+// reported to metrics and the access log after the fact.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (rec *statusRecorder) WriteHeader(status int) {
+	rec.status = status
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+// logAccess writes one JSON access log line per request.
+func logAccess(r *http.Request, status int, duration time.Duration) {
+	user := "-"
+	if session, err := store.Get(r, sessionName); err == nil {
+		if userID, ok := session.Values["user_id"].(int); ok {
+			user = fmt.Sprint(userID)
+		}
+	}
+
+	accessLogger.Println(accessLogEntry{
+		Method:     r.Method,
+		Path:       r.URL.Path,
+		Status:     status,
+		DurationMs: float64(duration) / float64(time.Millisecond),
+		User:       user,
+	})
+}
+
+// metricsHandler exposes the registry in the Prometheus text exposition
+// format at GET /metrics.
+func metricsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	metricsRegistry.Each(func(name string, i interface{}) {
+		switch m := i.(type) {
+		case metrics.Counter:
+			fmt.Fprintf(w, "%s %d\n", sanitizeMetricName(name), m.Count())
+		case metrics.Timer:
+			fmt.Fprintf(w, "%s_count %d\n", sanitizeMetricName(name), m.Count())
+			fmt.Fprintf(w, "%s_mean_ms %f\n", sanitizeMetricName(name), m.Mean()/float64(time.Millisecond))
+		}
+	})
+}
+
+// sanitizeMetricName turns a dotted internal metric name into something
+// that looks like a Prometheus metric name.
+func sanitizeMetricName(name string) string {
+	out := make([]byte, len(name))
+	for i := 0; i < len(name); i++ {
+		switch c := name[i]; {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '_':
+			out[i] = c
+		default:
+			out[i] = '_'
+		}
+	}
+	return "beaten_games_" + string(out)
+}